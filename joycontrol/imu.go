@@ -0,0 +1,121 @@
+package joycontrol
+
+import "sync"
+
+// imuSampleCount is how many samples a standard full report's IMU
+// section carries.
+const imuSampleCount = 3
+
+// IMUSample is one accelerometer/gyroscope reading, in the raw signed
+// 16-bit units the Switch expects on the wire.
+type IMUSample struct {
+	AccelX, AccelY, AccelZ int16
+	GyroX, GyroY, GyroZ    int16
+}
+
+// imuRingBuffer buffers samples pushed in by Protocol.PushIMUSample
+// until the next report drains some for its IMU section.
+type imuRingBuffer struct {
+	mu      sync.Mutex
+	samples []IMUSample
+	last    IMUSample
+	dropped uint64
+}
+
+func (r *imuRingBuffer) push(sample IMUSample) {
+	r.mu.Lock()
+	r.samples = append(r.samples, sample)
+	r.mu.Unlock()
+}
+
+// drain removes up to imuSampleCount queued samples, FIFO, repeating
+// the last sample seen (and counting it as dropped) if the caller has
+// fallen behind.
+func (r *imuRingBuffer) drain() [imuSampleCount]IMUSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out [imuSampleCount]IMUSample
+	for i := range out {
+		if len(r.samples) > 0 {
+			r.last = r.samples[0]
+			r.samples = r.samples[1:]
+		} else {
+			r.dropped++
+		}
+		out[i] = r.last
+	}
+	return out
+}
+
+func (r *imuRingBuffer) droppedCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// imuSectionOffset is where the IMU section begins within a standard
+// full report.
+const imuSectionOffset = 13
+
+func (r *InputReport) setImuSamples(samples [imuSampleCount]IMUSample) {
+	for i, sample := range samples {
+		offset := imuSectionOffset + i*12
+		putInt16LE(r[offset:], sample.AccelX)
+		putInt16LE(r[offset+2:], sample.AccelY)
+		putInt16LE(r[offset+4:], sample.AccelZ)
+		putInt16LE(r[offset+6:], sample.GyroX)
+		putInt16LE(r[offset+8:], sample.GyroY)
+		putInt16LE(r[offset+10:], sample.GyroZ)
+	}
+}
+
+func putInt16LE(b []byte, v int16) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+}
+
+// imuCalibration holds caller-supplied SPI calibration bytes standing
+// in for the factory (0x6020) and user (0x8028) calibration ranges a
+// real controller's flash would return.
+type imuCalibration struct {
+	factory [24]byte
+	user    [24]byte
+}
+
+// PushIMUSample queues one accelerometer/gyroscope reading for
+// inclusion in the next standard full report's IMU section.
+func (p *Protocol) PushIMUSample(accelX, accelY, accelZ, gyroX, gyroY, gyroZ int16) {
+	p.imuRing.push(IMUSample{
+		AccelX: accelX, AccelY: accelY, AccelZ: accelZ,
+		GyroX: gyroX, GyroY: gyroY, GyroZ: gyroZ,
+	})
+}
+
+// SetIMUCalibration overrides the factory (SPI address 0x6020) and
+// user (0x8028) calibration ranges returned by SPI reads.
+func (p *Protocol) SetIMUCalibration(factory, user [24]byte) {
+	p.imuCalibration = &imuCalibration{factory: factory, user: user}
+}
+
+const (
+	spiFactoryCalibrationAddr = 0x6020
+	spiUserCalibrationAddr    = 0x8028
+)
+
+// imuCalibrationOverride returns the caller-supplied calibration bytes
+// for an SpiFlashRead subcommand's address, or nil if none apply.
+func (p *Protocol) imuCalibrationOverride(data []byte) []byte {
+	if p.imuCalibration == nil || len(data) < 4 {
+		return nil
+	}
+
+	switch spiReadAddress(data) {
+	case spiFactoryCalibrationAddr:
+		return p.imuCalibration.factory[:]
+	case spiUserCalibrationAddr:
+		return p.imuCalibration.user[:]
+	default:
+		return nil
+	}
+}
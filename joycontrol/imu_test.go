@@ -0,0 +1,50 @@
+package joycontrol
+
+import "testing"
+
+func TestImuRingBufferDrainsFIFO(t *testing.T) {
+	r := &imuRingBuffer{}
+	r.push(IMUSample{AccelX: 1})
+	r.push(IMUSample{AccelX: 2})
+	r.push(IMUSample{AccelX: 3})
+
+	got := r.drain()
+	want := [imuSampleCount]int16{1, 2, 3}
+	for i, sample := range got {
+		if sample.AccelX != want[i] {
+			t.Fatalf("sample %d AccelX = %d, want %d", i, sample.AccelX, want[i])
+		}
+	}
+	if dropped := r.droppedCount(); dropped != 0 {
+		t.Fatalf("droppedCount() = %d, want 0", dropped)
+	}
+}
+
+func TestImuRingBufferRepeatsLastOnUnderrun(t *testing.T) {
+	r := &imuRingBuffer{}
+	r.push(IMUSample{AccelX: 7})
+
+	got := r.drain()
+	for i, sample := range got {
+		if sample.AccelX != 7 {
+			t.Fatalf("sample %d AccelX = %d, want 7 (repeated)", i, sample.AccelX)
+		}
+	}
+	if dropped := r.droppedCount(); dropped != imuSampleCount-1 {
+		t.Fatalf("droppedCount() = %d, want %d", dropped, imuSampleCount-1)
+	}
+}
+
+func TestImuRingBufferRepeatsZeroValueBeforeFirstPush(t *testing.T) {
+	r := &imuRingBuffer{}
+
+	got := r.drain()
+	for i, sample := range got {
+		if sample != (IMUSample{}) {
+			t.Fatalf("sample %d = %+v, want zero value", i, sample)
+		}
+	}
+	if dropped := r.droppedCount(); dropped != imuSampleCount {
+		t.Fatalf("droppedCount() = %d, want %d", dropped, imuSampleCount)
+	}
+}
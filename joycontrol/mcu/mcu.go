@@ -0,0 +1,227 @@
+// Package mcu emulates the NFC/IR MCU embedded in a real Joy-Con, just
+// enough of it to present a staged amiibo dump to the Switch. It tracks
+// the MCU's own state machine (separate from the controller's input
+// report mode) and answers the 1-byte commands the Switch sends in MCU
+// output reports with 313-byte MCU input reports.
+package mcu
+
+import (
+	"errors"
+	"sync"
+)
+
+// State is one of the MCU's operating states, as exposed by status
+// reports (0x31 replies carrying a state byte).
+type State byte
+
+const (
+	StateNotInitialized State = 0x00
+	StateStandBy        State = 0x01
+	StateNFC            State = 0x04
+	StateBusy           State = 0xFF
+)
+
+// Action identifies the 1-byte command carried by an MCU output report.
+type Action byte
+
+const (
+	ActionRequestStatus     Action = 0x01
+	ActionStartTagPolling   Action = 0x02
+	ActionStartTagDiscovery Action = 0x04
+	ActionReadTag           Action = 0x06
+	ActionReadTag2          Action = 0x07
+	ActionReadFinished      Action = 0x08
+)
+
+const (
+	// ReportSize is the length of an MCU input report, report ID 0x31,
+	// including the CRC-8 trailer over the MCU payload.
+	ReportSize = 313
+
+	// chunkSize is how many bytes of tag data are delivered per
+	// ReadTag/ReadTag2 reply.
+	chunkSize = 245
+)
+
+// ErrAmiiboSize is returned by SetAmiibo when given a dump that isn't a
+// standard NTAG215 amiibo size.
+var ErrAmiiboSize = errors.New("mcu: amiibo data must be 540 or 572 bytes")
+
+// ntag215UID is a synthesized NTAG215 UID/header used to introduce a
+// staged amiibo during tag discovery. Real amiibo carry a manufacturer
+// UID here; we fabricate one since we don't have a physical tag.
+var ntag215UID = [9]byte{0x04, 0x89, 0x34, 0x12, 0x56, 0x78, 0x9A, 0x00, 0x00}
+
+// MCU is a small state machine that stands in for the NFC MCU firmware.
+// It is safe for concurrent use.
+type MCU struct {
+	mu sync.Mutex
+
+	state  State
+	amiibo []byte
+	offset int
+}
+
+// New returns an MCU in its power-on state, with no tag staged.
+func New() *MCU {
+	return &MCU{state: StateNotInitialized}
+}
+
+// SetAmiibo stages the given amiibo dump so that it is presented the
+// next time the Switch polls for and discovers a tag. data must be a
+// standard 540 or 572-byte NTAG215 dump.
+func (m *MCU) SetAmiibo(data []byte) error {
+	if len(data) != 540 && len(data) != 572 {
+		return ErrAmiiboSize
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.amiibo = append([]byte(nil), data...)
+	m.offset = 0
+	return nil
+}
+
+// SetState moves the MCU to the given state, as driven by
+// SetNfcMcuState subcommands.
+func (m *MCU) SetState(state State) {
+	m.mu.Lock()
+	m.state = state
+	m.mu.Unlock()
+}
+
+// Configure applies an SetNfcMcuConfig subcommand's payload. Real
+// hardware uses the payload to pick a mode (NFC/IR/firmware-update)
+// and polling rate; we only need it to mark the MCU ready for the
+// polling handshake, so any config payload moves a freshly powered-on
+// MCU out of StateNotInitialized.
+func (m *MCU) Configure(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state == StateNotInitialized {
+		m.state = StateStandBy
+	}
+}
+
+// HandleOutputReport parses the 1-byte command from an MCU output
+// report and returns the 313-byte MCU input report to send back, or
+// nil if the command isn't valid from the MCU's current state (e.g. a
+// ReadTag before discovery has found a tag) or isn't understood.
+func (m *MCU) HandleOutputReport(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch Action(data[0]) {
+	case ActionRequestStatus:
+		// Valid from any state; it's how the Switch discovers what
+		// state the MCU is actually in.
+		return m.buildReport(0x01, []byte{byte(m.state)})
+	case ActionStartTagPolling:
+		if m.state != StateStandBy {
+			return nil
+		}
+		m.state = StateNFC
+		return m.buildReport(0x02, []byte{0x01})
+	case ActionStartTagDiscovery:
+		if m.state != StateNFC {
+			return nil
+		}
+		return m.startTagDiscovery()
+	case ActionReadTag, ActionReadTag2:
+		if m.state != StateBusy {
+			return nil
+		}
+		return m.readChunk()
+	case ActionReadFinished:
+		if m.state != StateBusy {
+			return nil
+		}
+		m.state = StateNFC
+		return m.buildReport(0x08, nil)
+	default:
+		return nil
+	}
+}
+
+func (m *MCU) startTagDiscovery() []byte {
+	if len(m.amiibo) == 0 {
+		return m.buildReport(0x03, []byte{0x00})
+	}
+
+	m.state = StateBusy
+	m.offset = 0
+
+	payload := append([]byte{0x01}, ntag215UID[:]...)
+	return m.buildReport(0x03, payload)
+}
+
+func (m *MCU) readChunk() []byte {
+	if len(m.amiibo) == 0 {
+		return m.buildReport(0x06, []byte{byte(errNoTagCode)})
+	}
+
+	end := m.offset + chunkSize
+	last := false
+	if end >= len(m.amiibo) {
+		end = len(m.amiibo)
+		last = true
+	}
+
+	chunk := m.amiibo[m.offset:end]
+	m.offset = end
+
+	payload := make([]byte, 0, len(chunk)+1)
+	payload = append(payload, boolByte(last))
+	payload = append(payload, chunk...)
+	return m.buildReport(0x06, payload)
+}
+
+const errNoTagCode = 0xFF
+
+func boolByte(b bool) byte {
+	if b {
+		return 0x01
+	}
+	return 0x00
+}
+
+// buildReport assembles a 313-byte MCU input report: report ID 0x31,
+// the given subcommand ack byte, payload, zero padding, and a CRC-8
+// trailer computed over all 312 bytes that precede it (report ID and
+// ack byte included).
+func (m *MCU) buildReport(ack byte, payload []byte) []byte {
+	report := make([]byte, ReportSize)
+	report[0] = 0x31
+	report[1] = ack
+	copy(report[2:], payload)
+
+	report[ReportSize-1] = crc8(report[:ReportSize-1])
+	return report
+}
+
+// crc8 computes the CRC-8 (poly 0x07, init 0x00) checksum the MCU
+// firmware appends as a trailer to every report it emits.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = (crc << 1) ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,116 @@
+package mcu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetAmiiboRejectsBadSize(t *testing.T) {
+	m := New()
+	if err := m.SetAmiibo(make([]byte, 100)); err != ErrAmiiboSize {
+		t.Fatalf("SetAmiibo with bad size = %v, want ErrAmiiboSize", err)
+	}
+	if err := m.SetAmiibo(make([]byte, 540)); err != nil {
+		t.Fatalf("SetAmiibo(540 bytes) = %v, want nil", err)
+	}
+}
+
+func TestHandleOutputReportGatesByState(t *testing.T) {
+	m := New()
+
+	if reply := m.HandleOutputReport([]byte{byte(ActionReadTag)}); reply != nil {
+		t.Fatalf("ReadTag from StateNotInitialized should be ignored, got reply")
+	}
+	if reply := m.HandleOutputReport([]byte{byte(ActionStartTagPolling)}); reply != nil {
+		t.Fatalf("StartTagPolling before Configure should be ignored, got reply")
+	}
+
+	m.Configure([]byte{0x01})
+	if reply := m.HandleOutputReport([]byte{byte(ActionStartTagDiscovery)}); reply != nil {
+		t.Fatalf("StartTagDiscovery before polling should be ignored, got reply")
+	}
+
+	if reply := m.HandleOutputReport([]byte{byte(ActionStartTagPolling)}); reply == nil {
+		t.Fatalf("StartTagPolling from StandBy should be answered")
+	}
+
+	if err := m.SetAmiibo(make([]byte, 540)); err != nil {
+		t.Fatalf("SetAmiibo: %v", err)
+	}
+
+	reply := m.HandleOutputReport([]byte{byte(ActionStartTagDiscovery)})
+	if reply == nil {
+		t.Fatalf("StartTagDiscovery from NFC state with a staged tag should be answered")
+	}
+
+	if reply := m.HandleOutputReport([]byte{byte(ActionReadTag)}); reply == nil {
+		t.Fatalf("ReadTag after discovery should be answered")
+	}
+}
+
+func TestReadTagDeliversFullAmiiboInChunks(t *testing.T) {
+	m := New()
+	m.Configure([]byte{0x01})
+	m.HandleOutputReport([]byte{byte(ActionStartTagPolling)})
+
+	amiibo := make([]byte, 540)
+	for i := range amiibo {
+		amiibo[i] = byte(i)
+	}
+	if err := m.SetAmiibo(amiibo); err != nil {
+		t.Fatalf("SetAmiibo: %v", err)
+	}
+	m.HandleOutputReport([]byte{byte(ActionStartTagDiscovery)})
+
+	var delivered []byte
+	for i := 0; i < 10; i++ {
+		reply := m.HandleOutputReport([]byte{byte(ActionReadTag)})
+		if reply == nil {
+			t.Fatalf("ReadTag returned no reply on chunk %d", i)
+		}
+		if len(reply) != ReportSize {
+			t.Fatalf("ReadTag reply length = %d, want %d", len(reply), ReportSize)
+		}
+
+		last := reply[2] == 0x01
+		delivered = append(delivered, reply[3:3+chunkSizeOrRemainder(len(amiibo), len(delivered))]...)
+		if last {
+			break
+		}
+	}
+	if !bytes.Equal(delivered, amiibo) {
+		t.Fatalf("ReadTag delivered %d bytes not matching the %d-byte amiibo", len(delivered), len(amiibo))
+	}
+
+	finish := m.HandleOutputReport([]byte{byte(ActionReadFinished)})
+	if finish == nil {
+		t.Fatalf("ActionReadFinished after the last chunk should be answered")
+	}
+	if finish[1] != 0x08 {
+		t.Fatalf("ActionReadFinished ack = 0x%02x, want 0x08", finish[1])
+	}
+}
+
+// chunkSizeOrRemainder mirrors readChunk's chunking so the test can
+// slice out exactly the bytes a given reply should have delivered.
+func chunkSizeOrRemainder(total, alreadyDelivered int) int {
+	remaining := total - alreadyDelivered
+	if remaining > chunkSize {
+		return chunkSize
+	}
+	return remaining
+}
+
+func TestCRC8IsAppendedAndVerifiable(t *testing.T) {
+	m := New()
+	reply := m.HandleOutputReport([]byte{byte(ActionRequestStatus)})
+	if reply == nil {
+		t.Fatal("RequestStatus should always be answered")
+	}
+
+	got := crc8(reply[:ReportSize-1])
+	want := reply[ReportSize-1]
+	if got != want {
+		t.Fatalf("trailer CRC-8 = 0x%02x, want 0x%02x", want, got)
+	}
+}
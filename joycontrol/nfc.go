@@ -0,0 +1,18 @@
+package joycontrol
+
+// NFCMCUReport is the report ID (0x31) used for NFC/IR MCU data, both
+// for the output reports the Switch sends the MCU and the input
+// reports the MCU answers with.
+const NFCMCUReport = 0x31
+
+// NFCMode is the input report mode byte (0x23) for on-demand NFC/IR
+// data reports, as opposed to the periodic cadences.
+const NFCMode = 0x23
+
+// AllocMCUReport allocates an InputReport for an NFC/IR MCU reply.
+// InputReport is sized to accommodate the largest input report the
+// Switch expects, the same backing type AllocStandardReport uses for
+// the smaller standard report.
+func AllocMCUReport() *InputReport {
+	return &InputReport{}
+}
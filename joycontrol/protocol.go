@@ -2,13 +2,38 @@ package joycontrol
 
 import (
 	"errors"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"dio.wtf/joycontrol/joycontrol/log"
+	"dio.wtf/joycontrol/joycontrol/mcu"
 	"golang.org/x/sys/unix"
 )
 
+// defaultEpollTimeout bounds how long readOutputReport blocks in
+// EpollWait between checks, so that a timeout changed with
+// SetEpollTimeout takes effect on the next wait.
+const defaultEpollTimeout = 100 * time.Millisecond
+
+// Per-mode periodic input report intervals. StandardFullMode is the
+// normal 60Hz-ish button/stick cadence; the MCU report picks up the
+// pace to keep NFC/IR MCU data flowing; NFCMode reports are pushed on
+// demand by the MCU state machine rather than on a timer.
+const (
+	standardFullModeInterval = 15 * time.Millisecond
+	mcuModeInterval          = 8333 * time.Microsecond
+)
+
+// Stats holds counters describing the health of the output report
+// reader and input report queue, as returned by Protocol.Stats.
+type Stats struct {
+	ReportsRead       uint64
+	ReportsDropped    uint64
+	EpollWakeups      uint64
+	IMUSamplesDropped uint64
+}
+
 type Protocol struct {
 	lastTime           time.Time
 	elapsed            int64
@@ -18,6 +43,29 @@ type Protocol struct {
 
 	queue  chan *InputReport
 	output *OutputReport
+	mcu    *mcu.MCU
+
+	// epollTimeoutNs is a time.Duration in nanoseconds, accessed via
+	// sync/atomic since SetEpollTimeout can be called from any goroutine.
+	epollTimeoutNs int64
+
+	// reportMode and reportRateNs are accessed only through sync/atomic,
+	// since they're written from answerSetMode/SetReportRate and read
+	// from runReportLoop's goroutine.
+	reportMode   uint32
+	modeChanged  chan byte
+	reportRateNs int64
+
+	imuRing        *imuRingBuffer
+	imuCalibration *imuCalibration
+	spiFlash       SPIFlash
+
+	rumbleDecoder RumbleDecoder
+	onRumble      func(RumbleFrame)
+
+	reportsRead    uint64
+	reportsDropped uint64
+	epollWakeups   uint64
 
 	itr, ctrl int
 	macAddr   []byte
@@ -25,11 +73,77 @@ type Protocol struct {
 
 func NewProtocol() *Protocol {
 	return &Protocol{
-		queue:  make(chan *InputReport, 5),
-		output: &OutputReport{},
+		queue:          make(chan *InputReport, 5),
+		output:         &OutputReport{},
+		mcu:            mcu.New(),
+		epollTimeoutNs: int64(defaultEpollTimeout),
+		reportMode:     uint32(StandardFullMode),
+		modeChanged:    make(chan byte, 1),
+		imuRing:        &imuRingBuffer{},
+		spiFlash:       &FileSPIFlash{},
+	}
+}
+
+// SetSPIFlash overrides the SPI flash backing store SpiFlashRead
+// subcommands are answered from. Pass a FileSPIFlash loaded with
+// NewFileSPIFlash to supply real dumped controller flash (stick
+// calibration, colors, user data) in place of the zeroed default.
+func (p *Protocol) SetSPIFlash(flash SPIFlash) {
+	p.spiFlash = flash
+}
+
+// Stats returns a snapshot of the reader/writer counters. Safe to call
+// from any goroutine.
+func (p *Protocol) Stats() Stats {
+	return Stats{
+		ReportsRead:       atomic.LoadUint64(&p.reportsRead),
+		ReportsDropped:    atomic.LoadUint64(&p.reportsDropped),
+		EpollWakeups:      atomic.LoadUint64(&p.epollWakeups),
+		IMUSamplesDropped: p.imuRing.droppedCount(),
+	}
+}
+
+// SetEpollTimeout overrides how long readOutputReport blocks in
+// EpollWait between wakeups. Mainly useful for tests.
+func (p *Protocol) SetEpollTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&p.epollTimeoutNs, int64(timeout))
+}
+
+func (p *Protocol) getEpollTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.epollTimeoutNs))
+}
+
+// enqueue hands a report to the writer goroutine without blocking. If
+// the Switch is stalled and the queue is full, the oldest queued
+// report is dropped to make room, since a stale input report is worse
+// than no report at all.
+func (p *Protocol) enqueue(report *InputReport) {
+	select {
+	case p.queue <- report:
+		return
+	default:
+	}
+
+	select {
+	case <-p.queue:
+		atomic.AddUint64(&p.reportsDropped, 1)
+	default:
+	}
+
+	select {
+	case p.queue <- report:
+	default:
+		atomic.AddUint64(&p.reportsDropped, 1)
 	}
 }
 
+// SetAmiibo stages an amiibo dump (a standard 540 or 572-byte NTAG215
+// image) so that it is presented to the Switch the next time it polls
+// for and discovers an NFC tag.
+func (p *Protocol) SetAmiibo(data []byte) error {
+	return p.mcu.SetAmiibo(data)
+}
+
 func (p *Protocol) Setup(itr, ctrl int, macAddr []byte) {
 	p.itr = itr
 	p.ctrl = ctrl
@@ -40,17 +154,94 @@ func (p *Protocol) Setup(itr, ctrl int, macAddr []byte) {
 		return
 	}
 
-	go p.sendEmptyReport()
+	go p.runReportLoop()
 	go p.processInputQueue()
 	go p.readOutputReport()
 }
 
-func (p *Protocol) sendEmptyReport() {
-	ticker := time.NewTicker(time.Second)
+// runReportLoop drives the periodic input report cadence, restarting
+// its ticker whenever the negotiated mode or rate changes.
+func (p *Protocol) runReportLoop() {
+	mode := p.getReportMode()
+	var ticker *time.Ticker
+	if interval := p.intervalFor(mode); interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	for {
+		var tick <-chan time.Time
+		if ticker != nil {
+			tick = ticker.C
+		}
+
+		select {
+		case mode = <-p.modeChanged:
+			if ticker != nil {
+				ticker.Stop()
+				ticker = nil
+			}
+			if interval := p.intervalFor(mode); interval > 0 {
+				ticker = time.NewTicker(interval)
+			}
+		case <-tick:
+			p.processModeReport(mode)
+		}
+	}
+}
+
+// intervalFor returns the periodic report interval for mode, honoring
+// any SetReportRate override; zero means on-demand rather than timed.
+func (p *Protocol) intervalFor(mode byte) time.Duration {
+	if rate := p.getReportRate(); rate > 0 {
+		return rate
+	}
+
+	switch mode {
+	case StandardFullMode:
+		return standardFullModeInterval
+	case NFCMCUReport:
+		return mcuModeInterval
+	case NFCMode:
+		return 0
+	default:
+		return standardFullModeInterval
+	}
+}
+
+func (p *Protocol) getReportMode() byte {
+	return byte(atomic.LoadUint32(&p.reportMode))
+}
+
+func (p *Protocol) getReportRate() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.reportRateNs))
+}
+
+// setReportMode records the negotiated mode and wakes runReportLoop.
+func (p *Protocol) setReportMode(mode byte) {
+	atomic.StoreUint32(&p.reportMode, uint32(mode))
+
+	select {
+	case p.modeChanged <- mode:
+		return
+	default:
+	}
+
+	select {
+	case <-p.modeChanged:
+	default:
+	}
+	select {
+	case p.modeChanged <- mode:
+	default:
+	}
+}
 
-	<-ticker.C
-	p.processStandardFullReport()
-	ticker.Stop()
+// SetReportRate overrides the periodic input report interval derived
+// from the negotiated mode; pass 0 to restore the default.
+func (p *Protocol) SetReportRate(rate time.Duration) {
+	atomic.StoreInt64(&p.reportRateNs, int64(rate))
+	p.setReportMode(p.getReportMode())
 }
 
 func (p *Protocol) processInputQueue() {
@@ -65,40 +256,130 @@ func (p *Protocol) processInputQueue() {
 }
 
 func (p *Protocol) readOutputReport() {
-	// TODO: use EPOLL to improve performance
+	epfd, err := unix.EpollCreate1(0)
+	if err != nil {
+		log.ErrorF("error creating epoll instance: %v", err)
+		return
+	}
+	defer unix.Close(epfd)
+
+	event := unix.EpollEvent{Events: unix.EPOLLIN | unix.EPOLLET, Fd: int32(p.itr)}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, p.itr, &event); err != nil {
+		log.ErrorF("error registering interrupt fd with epoll: %v", err)
+		return
+	}
+
+	events := make([]unix.EpollEvent, 1)
+
+	for {
+		timeoutMs := int(p.getEpollTimeout() / time.Millisecond)
+		n, err := unix.EpollWait(epfd, events, timeoutMs)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			log.ErrorF("error waiting on epoll: %v", err)
+			return
+		}
+
+		atomic.AddUint64(&p.epollWakeups, 1)
+		if n == 0 {
+			// Timed out with nothing ready; go back around so a
+			// changed epollTimeout is picked up.
+			continue
+		}
+
+		if !p.drainOutputReports() {
+			return
+		}
+	}
+}
+
+// drainOutputReports reads output reports until the itr fd returns
+// EAGAIN, i.e. until the edge-triggered EPOLLIN event has been fully
+// consumed. It returns false if the reader should stop altogether.
+func (p *Protocol) drainOutputReports() bool {
 	for {
 		err := p.output.load(p.itr)
 		if err != nil {
 			switch {
 			case errors.Is(err, syscall.EAGAIN):
-				continue
+				return true
 			case errors.Is(err, errEmptyData), errors.Is(err, errBadLengthData), errors.Is(err, errMalformedData):
 				// TODO: Setting Report ID to full standard input report ID
 				p.processStandardFullReport()
-				return
+				return false
 			default:
 				log.ErrorF("error reading output report: %v", err)
-				return
+				return false
 			}
 		}
 
+		atomic.AddUint64(&p.reportsRead, 1)
 		p.reportReceived = true
 		log.DebugF("output report read %s", p.output)
 		switch p.output.id {
 		case RumbleAndSubcommand:
+			p.dispatchRumble()
 			p.processSubcommandReport(p.output)
-		case UpdateNFCPacket:
+		case UpdateNFCPacket, RequestNFCData:
+			p.processMCUReport(p.output.getSubcommandData())
 		case RumbleOnly:
-		case RequestNFCData:
+			p.dispatchRumble()
 		}
 	}
 }
 
+// dispatchRumble decodes the rumble payload carried by every RumbleOnly
+// and RumbleAndSubcommand output report and hands it to OnRumble.
+func (p *Protocol) dispatchRumble() {
+	if p.onRumble == nil {
+		return
+	}
+	p.onRumble(p.rumbleDecoder.Decode(p.output.getRumbleData()))
+}
+
+// OnRumble registers a callback invoked with every decoded HD Rumble frame.
+func (p *Protocol) OnRumble(fn func(RumbleFrame)) {
+	p.onRumble = fn
+}
+
+func (p *Protocol) processMCUReport(data []byte) {
+	reply := p.mcu.HandleOutputReport(data)
+	if reply == nil {
+		return
+	}
+
+	report := AllocMCUReport()
+	report.setReportId(NFCMCUReport)
+	copy(report[:], reply)
+	p.enqueue(report)
+}
+
 func (p Protocol) processStandardFullReport() {
+	p.buildAndEnqueueReport(StandardFullMode)
+}
+
+// processModeReport builds and enqueues the periodic report tagged for
+// the negotiated mode, rather than always sending StandardFullMode.
+func (p Protocol) processModeReport(mode byte) {
+	switch mode {
+	case NFCMCUReport:
+		p.buildAndEnqueueReport(NFCMCUReport)
+	default:
+		p.buildAndEnqueueReport(StandardFullMode)
+	}
+}
+
+func (p Protocol) buildAndEnqueueReport(reportID byte) {
 	report := AllocStandardReport()
-	report.setReportId(StandardFullMode)
-	report.setImuData(p.imuEnabled)
-	p.queue <- report
+	report.setReportId(reportID)
+	if p.imuEnabled {
+		report.setImuSamples(p.imuRing.drain())
+	} else {
+		report.setImuData(p.imuEnabled)
+	}
+	p.enqueue(report)
 }
 
 func (p *Protocol) processSubcommandReport(report *OutputReport) {
@@ -136,12 +417,15 @@ func (p *Protocol) processSubcommandReport(report *OutputReport) {
 }
 
 func (p *Protocol) answerSetMode(data []byte) {
-	// TODO: Update input report mode
+	if len(data) > 0 {
+		p.setReportMode(data[0])
+	}
+
 	report := AllocStandardReport()
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackSetInputReportMode()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) anwserTriggerButtonsElapsedTime() {
@@ -149,7 +433,7 @@ func (p *Protocol) anwserTriggerButtonsElapsedTime() {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackTriggerButtonsElapsedTime()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerDeviceInfo() {
@@ -159,7 +443,7 @@ func (p *Protocol) answerDeviceInfo() {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackDeviceInfo(p.macAddr)
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerSetShipmentState() {
@@ -167,33 +451,53 @@ func (p *Protocol) answerSetShipmentState() {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackSetShipmentLowPowerState()
-	p.queue <- report
+	p.enqueue(report)
 }
 
+// answerSpiRead reads the address range an SpiFlashRead subcommand
+// asks for and packs the result into the reply.
 func (p *Protocol) answerSpiRead(data []byte) {
+	if len(data) < 5 {
+		return
+	}
+
+	addr := spiReadAddress(data)
+	length := int(data[4])
+
+	buf := make([]byte, length)
+	if override := p.imuCalibrationOverride(data); override != nil {
+		copy(buf, override)
+	} else if _, err := p.spiFlash.ReadAt(buf, int64(addr)); err != nil {
+		log.ErrorF("error reading spi flash at 0x%x: %v", addr, err)
+	}
+
 	report := AllocStandardReport()
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
-	report.ackSpiFlashRead(data)
-	p.queue <- report
+	report.ackSpiFlashReadAt(addr, buf)
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerSetNfcMcuConfig(data []byte) {
-	// TODO: Update NFC MCU config
+	p.mcu.Configure(data)
+
 	report := AllocStandardReport()
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackSetNfcMcuConfig()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerSetNfcMcuState(data []byte) {
-	// TODO: Update NFC MCU State
+	if len(data) > 0 {
+		p.mcu.SetState(mcu.State(data[0]))
+	}
+
 	report := AllocStandardReport()
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackSetNfcMcuState()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerSetPlayerLights() {
@@ -201,7 +505,7 @@ func (p *Protocol) answerSetPlayerLights() {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackSetPlayerLights()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerEnableImu(data []byte) {
@@ -213,7 +517,7 @@ func (p *Protocol) answerEnableImu(data []byte) {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackEnableImu()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) answerEnableVibration() {
@@ -221,7 +525,7 @@ func (p *Protocol) answerEnableVibration() {
 	report.setReportId(SubcommandReplies)
 	report.fillStandardData(p.elapsed, p.deviceInfoRequired)
 	report.ackEnableVibration()
-	p.queue <- report
+	p.enqueue(report)
 }
 
 func (p *Protocol) updateTimer() {
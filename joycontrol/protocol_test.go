@@ -0,0 +1,43 @@
+package joycontrol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnqueueDropsOldestWhenFull(t *testing.T) {
+	p := NewProtocol()
+
+	const capacity = 5
+	for i := 0; i < capacity+2; i++ {
+		p.enqueue(&InputReport{})
+	}
+
+	if got := p.Stats().ReportsDropped; got != 2 {
+		t.Fatalf("ReportsDropped = %d, want 2", got)
+	}
+	if len(p.queue) != capacity {
+		t.Fatalf("queue length = %d, want %d", len(p.queue), capacity)
+	}
+}
+
+func TestSetEpollTimeoutTakesEffect(t *testing.T) {
+	p := NewProtocol()
+
+	p.SetEpollTimeout(50 * time.Millisecond)
+	if got := p.getEpollTimeout(); got != 50*time.Millisecond {
+		t.Fatalf("getEpollTimeout() = %v, want 50ms", got)
+	}
+}
+
+func TestAnswerSpiReadIgnoresShortPayload(t *testing.T) {
+	p := NewProtocol()
+
+	p.answerSpiRead([]byte{0x01, 0x02, 0x03})
+
+	select {
+	case <-p.queue:
+		t.Fatal("answerSpiRead should not enqueue a reply for a short payload")
+	default:
+	}
+}
@@ -0,0 +1,104 @@
+package joycontrol
+
+import "math"
+
+// RumbleFrame is one decoded HD Rumble instruction: independent
+// high-band and low-band frequency (Hz) and amplitude (0.0-1.0) values
+// for each side of the controller.
+type RumbleFrame struct {
+	LeftHiFreq, LeftHiAmp   float64
+	LeftLoFreq, LeftLoAmp   float64
+	RightHiFreq, RightHiAmp float64
+	RightLoFreq, RightLoAmp float64
+}
+
+// RumbleDecoder decodes the 8-byte HD Rumble payload that precedes the
+// subcommand in RumbleOnly and RumbleAndSubcommand output reports: 4
+// bytes per side, each packing a high-band and low-band frequency/
+// amplitude pair.
+type RumbleDecoder struct{}
+
+// Decode parses an 8-byte rumble payload into a RumbleFrame.
+func (RumbleDecoder) Decode(data [8]byte) RumbleFrame {
+	leftHiFreq, leftHiAmp, leftLoFreq, leftLoAmp := decodeRumbleSide(data[0:4])
+	rightHiFreq, rightHiAmp, rightLoFreq, rightLoAmp := decodeRumbleSide(data[4:8])
+
+	return RumbleFrame{
+		LeftHiFreq: leftHiFreq, LeftHiAmp: leftHiAmp,
+		LeftLoFreq: leftLoFreq, LeftLoAmp: leftLoAmp,
+		RightHiFreq: rightHiFreq, RightHiAmp: rightHiAmp,
+		RightLoFreq: rightLoFreq, RightLoAmp: rightLoAmp,
+	}
+}
+
+// decodeRumbleSide unpacks one side's 4-byte HD Rumble quad: a 9-bit
+// high-band frequency index spanning all of b[0] and the top bit of
+// b[1], a 7-bit high-band amplitude index in the rest of b[1], and
+// 7-bit low-band frequency/amplitude indices in b[2] and b[3]. No bit
+// is shared between two fields.
+func decodeRumbleSide(b []byte) (hiFreq, hiAmp, loFreq, loAmp float64) {
+	hfRaw := uint16(b[0])<<1 | uint16(b[1]>>7)
+	hiFreq = rumbleFreqFromHex(hfRaw)
+	hiAmp = rumbleAmpFromHex(b[1] & 0x7F)
+
+	loFreq = rumbleFreqFromHex(uint16(b[2] & 0x7F))
+	loAmp = rumbleAmpFromHex(b[3] & 0x7F)
+
+	return
+}
+
+// rumbleFreqTable maps a 9-bit encoded frequency index to Hz, per the
+// formula freq = 10 * 2^(index/32).
+var rumbleFreqTable = buildRumbleFreqTable()
+
+func buildRumbleFreqTable() [512]float64 {
+	var table [512]float64
+	for i := range table {
+		table[i] = 10.0 * math.Pow(2, float64(i)/32.0)
+	}
+	return table
+}
+
+func rumbleFreqFromHex(index uint16) float64 {
+	if int(index) >= len(rumbleFreqTable) {
+		index = uint16(len(rumbleFreqTable) - 1)
+	}
+	return rumbleFreqTable[index]
+}
+
+// rumbleAmpTable maps a 7-bit encoded amplitude index to a 0.0-1.0
+// amplitude. This is a linear approximation, not the real (non-linear)
+// HD Rumble amplitude curve.
+var rumbleAmpTable = buildRumbleAmpTable()
+
+func buildRumbleAmpTable() [128]float64 {
+	var table [128]float64
+	for i := range table {
+		switch {
+		case i == 0:
+			table[i] = 0
+		case i >= 0x64:
+			table[i] = 1.0
+		default:
+			table[i] = float64(i) / 0x64
+		}
+	}
+	return table
+}
+
+func rumbleAmpFromHex(index byte) float64 {
+	if int(index) >= len(rumbleAmpTable) {
+		return 1.0
+	}
+	return rumbleAmpTable[index]
+}
+
+// rumbleDataOffset is where the 8-byte HD Rumble payload begins in a
+// RumbleOnly/RumbleAndSubcommand output report.
+const rumbleDataOffset = 2
+
+func (o *OutputReport) getRumbleData() [8]byte {
+	var data [8]byte
+	copy(data[:], o[rumbleDataOffset:rumbleDataOffset+8])
+	return data
+}
@@ -0,0 +1,85 @@
+package joycontrol
+
+import "testing"
+
+func TestRumbleFreqFromHexMatchesFormula(t *testing.T) {
+	cases := []struct {
+		index uint16
+		want  float64
+	}{
+		{0, 10.0},
+		{32, 20.0},
+		{64, 40.0},
+	}
+
+	for _, c := range cases {
+		if got := rumbleFreqFromHex(c.index); got != c.want {
+			t.Errorf("rumbleFreqFromHex(%d) = %v, want %v", c.index, got, c.want)
+		}
+	}
+}
+
+func TestRumbleFreqFromHexClampsOutOfRangeIndex(t *testing.T) {
+	got := rumbleFreqFromHex(9999)
+	want := rumbleFreqTable[len(rumbleFreqTable)-1]
+	if got != want {
+		t.Fatalf("rumbleFreqFromHex(9999) = %v, want %v (clamped)", got, want)
+	}
+}
+
+func TestRumbleAmpFromHex(t *testing.T) {
+	cases := []struct {
+		index byte
+		want  float64
+	}{
+		{0x00, 0},
+		{0x64, 1.0},
+		{0x7F, 1.0},
+	}
+
+	for _, c := range cases {
+		if got := rumbleAmpFromHex(c.index); got != c.want {
+			t.Errorf("rumbleAmpFromHex(0x%02x) = %v, want %v", c.index, got, c.want)
+		}
+	}
+}
+
+func TestDecodeRumbleSideFieldsDoNotOverlap(t *testing.T) {
+	hiFreq, hiAmp, _, _ := decodeRumbleSide([]byte{0xFF, 0x80, 0x00, 0x00})
+	if want := rumbleFreqTable[0x1FF]; hiFreq != want {
+		t.Fatalf("hiFreq with b[0]=0xFF b[1] top bit set = %v, want max table entry %v", hiFreq, want)
+	}
+	if hiAmp != 0 {
+		t.Fatalf("hiAmp = %v, want 0 when b[1]'s low 7 bits are 0", hiAmp)
+	}
+
+	_, _, loFreq, loAmp := decodeRumbleSide([]byte{0x00, 0x00, 0x80, 0x7F})
+	if want := rumbleFreqTable[0]; loFreq != want {
+		t.Fatalf("loFreq = %v, want %v when b[2]'s low 7 bits are 0", loFreq, want)
+	}
+	if want := rumbleAmpFromHex(0x7F); loAmp != want {
+		t.Fatalf("loAmp = %v, want %v to depend only on b[3]&0x7F", loAmp, want)
+	}
+}
+
+func TestRumbleDecoderDecodesZeroPayloadAsSilent(t *testing.T) {
+	var decoder RumbleDecoder
+	frame := decoder.Decode([8]byte{})
+
+	if frame.LeftHiFreq != rumbleFreqTable[0] || frame.RightHiFreq != rumbleFreqTable[0] {
+		t.Fatalf("zero payload should decode to the lowest table frequency, got %+v", frame)
+	}
+	if frame.LeftHiAmp != 0 || frame.RightHiAmp != 0 {
+		t.Fatalf("zero payload should decode to silent amplitude, got %+v", frame)
+	}
+}
+
+func TestGetRumbleDataReadsReportOffset(t *testing.T) {
+	var report OutputReport
+	want := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	copy(report[rumbleDataOffset:], want[:])
+
+	if got := report.getRumbleData(); got != want {
+		t.Fatalf("getRumbleData() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+package joycontrol
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// spiFlashSize is the size of a real Joy-Con's SPI flash chip.
+const spiFlashSize = 512 * 1024
+
+// SPIFlash abstracts the backing store an SpiFlashRead subcommand
+// reads from.
+type SPIFlash interface {
+	ReadAt(p []byte, off int64) (int, error)
+}
+
+// FileSPIFlash is the default SPIFlash: a 512KB image held in memory
+// and, when constructed with a path, backed by a file on disk.
+type FileSPIFlash struct {
+	mu   sync.Mutex
+	path string
+	data [spiFlashSize]byte
+}
+
+// NewFileSPIFlash loads a 512KB flash image from path. If the file
+// doesn't exist, a zeroed image is used and will be created at path on
+// the first WriteAt or Save.
+func NewFileSPIFlash(path string) (*FileSPIFlash, error) {
+	flash := &FileSPIFlash{path: path}
+
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return flash, nil
+	case err != nil:
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := io.ReadFull(file, flash.data[:]); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return flash, nil
+}
+
+func (f *FileSPIFlash) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if off < 0 || off > spiFlashSize {
+		return 0, errors.New("joycontrol: spi flash offset out of range")
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+// WriteAt writes into the in-memory image and, if constructed with a
+// path, persists the whole image back to disk.
+func (f *FileSPIFlash) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	if off < 0 || off > spiFlashSize {
+		f.mu.Unlock()
+		return 0, errors.New("joycontrol: spi flash offset out of range")
+	}
+	n := copy(f.data[off:], p)
+	f.mu.Unlock()
+
+	if f.path == "" {
+		return n, nil
+	}
+	return n, f.Save()
+}
+
+// Save writes the whole image to disk. It is a no-op for an
+// in-memory-only flash.
+func (f *FileSPIFlash) Save() error {
+	if f.path == "" {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return os.WriteFile(f.path, f.data[:], 0o600)
+}
+
+// spiReadAddress decodes the 4-byte little-endian address at the
+// start of an SpiFlashRead subcommand's data.
+func spiReadAddress(data []byte) uint32 {
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+}
+
+// spiReadSubcommandID is echoed back in an SpiFlashRead reply's ack
+// section.
+const spiReadSubcommandID = 0x10
+
+// spiAckOffset is where the ack byte of a subcommand reply begins.
+const spiAckOffset = 13
+
+func (r *InputReport) ackSpiFlashReadAt(addr uint32, data []byte) {
+	section := r[spiAckOffset:]
+	section[0] = 0x90
+	section[1] = spiReadSubcommandID
+	section[2] = byte(addr)
+	section[3] = byte(addr >> 8)
+	section[4] = byte(addr >> 16)
+	section[5] = byte(addr >> 24)
+	section[6] = byte(len(data))
+	copy(section[7:], data)
+}
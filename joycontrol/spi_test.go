@@ -0,0 +1,87 @@
+package joycontrol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSPIFlashInMemoryReadWrite(t *testing.T) {
+	flash := &FileSPIFlash{}
+
+	if _, err := flash.WriteAt([]byte{0xAA, 0xBB}, 0x100); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+
+	buf := make([]byte, 2)
+	if _, err := flash.ReadAt(buf, 0x100); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if buf[0] != 0xAA || buf[1] != 0xBB {
+		t.Fatalf("ReadAt = %v, want [0xAA 0xBB]", buf)
+	}
+}
+
+func TestFileSPIFlashRejectsOutOfRangeOffset(t *testing.T) {
+	flash := &FileSPIFlash{}
+
+	if _, err := flash.ReadAt(make([]byte, 1), spiFlashSize+1); err == nil {
+		t.Fatal("ReadAt past spiFlashSize should error")
+	}
+	if _, err := flash.WriteAt([]byte{0x01}, -1); err == nil {
+		t.Fatal("WriteAt with negative offset should error")
+	}
+}
+
+func TestFileSPIFlashPersistsToDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flash.bin")
+
+	flash, err := NewFileSPIFlash(path)
+	if err != nil {
+		t.Fatalf("NewFileSPIFlash: %v", err)
+	}
+	if _, err := flash.WriteAt([]byte{0x42}, 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+
+	reloaded, err := NewFileSPIFlash(path)
+	if err != nil {
+		t.Fatalf("NewFileSPIFlash (reload): %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := reloaded.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if buf[0] != 0x42 {
+		t.Fatalf("ReadAt after reload = 0x%x, want 0x42", buf[0])
+	}
+}
+
+func TestNewFileSPIFlashMissingFileIsZeroed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.bin")
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("expected path not to exist")
+	}
+
+	flash, err := NewFileSPIFlash(path)
+	if err != nil {
+		t.Fatalf("NewFileSPIFlash: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := flash.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	for _, b := range buf {
+		if b != 0 {
+			t.Fatalf("ReadAt on missing image = %v, want zeroed", buf)
+		}
+	}
+}
+
+func TestSpiReadAddressDecodesLittleEndian(t *testing.T) {
+	got := spiReadAddress([]byte{0x20, 0x60, 0x00, 0x00})
+	if want := uint32(0x6020); got != want {
+		t.Fatalf("spiReadAddress = 0x%x, want 0x%x", got, want)
+	}
+}